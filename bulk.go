@@ -0,0 +1,156 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"sync"
+)
+
+// 批量创建时并发解析重定向的协程数
+const bulkResolveWorkers = 8
+
+// 单条记录允许的最大字节数，用于限制整个请求体的大小
+const maxBulkEntryBytes = 8 << 10
+
+var errBatchTooLarge = errors.New("batch exceeds the maximum size")
+
+// bulkLimiter 按条目数而不是请求数限流，为 nil 时不限流
+var bulkLimiter *rateLimiter
+
+type bulkEntry struct {
+	LongURL    string `json:"long_url"`
+	CustomCode string `json:"custom_code,omitempty"`
+}
+
+type bulkResult struct {
+	ShortURL string `json:"short_url,omitempty"`
+	Error    string `json:"error,omitempty"`
+	Code     string `json:"code,omitempty"`
+}
+
+func handleBulkCreateShortURL(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeJSONError(w, http.StatusMethodNotAllowed, "method_not_allowed", "Only POST is allowed")
+		return
+	}
+
+	body := http.MaxBytesReader(w, r.Body, int64(bulkMaxSize+1)*maxBulkEntryBytes)
+	entries, err := decodeBulkEntries(body)
+	var maxBytesErr *http.MaxBytesError
+	if errors.Is(err, errBatchTooLarge) || errors.As(err, &maxBytesErr) {
+		writeJSONError(w, http.StatusRequestEntityTooLarge, "batch_too_large", "Batch exceeds the maximum size")
+		return
+	} else if err != nil {
+		writeJSONError(w, http.StatusBadRequest, "invalid_body", "Request body must be a JSON array")
+		return
+	}
+
+	// 每条记录都会发起外部请求，按条目数扣除令牌
+	if bulkLimiter != nil {
+		if float64(len(entries)) > bulkLimiter.burst {
+			writeJSONError(w, http.StatusRequestEntityTooLarge, "batch_too_large", "Batch exceeds the rate limit burst")
+			return
+		}
+		if ok, wait := bulkLimiter.allowN(clientIP(r), len(entries)); !ok {
+			writeRateLimited(w, wait)
+			return
+		}
+	}
+
+	results := make([]bulkResult, len(entries))
+	cleanURLs := resolveBulkEntries(r.Context(), entries, results)
+
+	// 所有记录在同一个事务中写入，单条失败只影响该条结果
+	err = store.WithTx(func(tx Store) error {
+		for i, entry := range entries {
+			if results[i].Error != "" {
+				continue
+			}
+			shortCode, cerr := insertShortURL(tx, cleanURLs[i], entry.CustomCode, sql.NullTime{}, http.StatusFound)
+			if cerr != nil {
+				results[i] = bulkResult{Error: cerr.message, Code: cerr.code}
+				continue
+			}
+			results[i].ShortURL = domain + "/" + shortCode
+		}
+		return nil
+	})
+	if err != nil {
+		writeJSONError(w, http.StatusInternalServerError, "database_error", "Failed to commit batch")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(results)
+}
+
+// decodeBulkEntries 逐条解码 JSON 数组，超过 bulkMaxSize 时立即停止
+func decodeBulkEntries(body io.Reader) ([]bulkEntry, error) {
+	dec := json.NewDecoder(body)
+	if tok, err := dec.Token(); err != nil {
+		return nil, err
+	} else if delim, ok := tok.(json.Delim); !ok || delim != '[' {
+		return nil, errors.New("body is not a JSON array")
+	}
+
+	entries := []bulkEntry{}
+	for dec.More() {
+		if len(entries) >= bulkMaxSize {
+			return nil, errBatchTooLarge
+		}
+		var entry bulkEntry
+		if err := dec.Decode(&entry); err != nil {
+			return nil, err
+		}
+		entries = append(entries, entry)
+	}
+
+	// 读取结尾的 ]
+	if _, err := dec.Token(); err != nil {
+		return nil, err
+	}
+	return entries, nil
+}
+
+// resolveBulkEntries 并发校验和解析每条链接，失败的条目直接写入 results
+func resolveBulkEntries(ctx context.Context, entries []bulkEntry, results []bulkResult) []string {
+	cleanURLs := make([]string, len(entries))
+	indexes := make(chan int)
+
+	var wg sync.WaitGroup
+	for i := 0; i < bulkResolveWorkers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range indexes {
+				entry := entries[i]
+				if entry.LongURL == "" {
+					results[i] = bulkResult{Error: "Missing long_url", Code: "missing_long_url"}
+					continue
+				}
+				if entry.CustomCode != "" && !isValidCustomCode(entry.CustomCode) {
+					results[i] = bulkResult{Error: "Invalid custom_code", Code: "invalid_custom_code"}
+					continue
+				}
+				cleanURL, cerr := resolveCleanURL(ctx, entry.LongURL, paramOverrides{})
+				if cerr != nil {
+					results[i] = bulkResult{Error: cerr.message, Code: cerr.code}
+					continue
+				}
+				cleanURLs[i] = cleanURL
+			}
+		}()
+	}
+
+	for i := range entries {
+		indexes <- i
+	}
+	close(indexes)
+	wg.Wait()
+
+	return cleanURLs
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"log"
+	"sync"
+	"time"
+)
+
+// clickRecorder 在后台批量累加点击数，避免每次跳转都同步写库
+type clickRecorder struct {
+	store    Store
+	clicks   chan string
+	done     chan struct{}
+	wg       sync.WaitGroup
+	interval time.Duration
+}
+
+var recorder *clickRecorder
+
+func startClickRecorder(store Store, interval time.Duration) *clickRecorder {
+	recorder = &clickRecorder{
+		store:    store,
+		clicks:   make(chan string, 1024),
+		done:     make(chan struct{}),
+		interval: interval,
+	}
+	recorder.wg.Add(1)
+	go recorder.run()
+	return recorder
+}
+
+// recordClick 不会阻塞跳转，队列已满时丢弃本次计数
+func recordClick(shortCode string) {
+	if recorder == nil {
+		return
+	}
+	select {
+	case recorder.clicks <- shortCode:
+	default:
+		log.Printf("Click queue full, dropping click for %s\n", shortCode)
+	}
+}
+
+func (c *clickRecorder) run() {
+	defer c.wg.Done()
+
+	ticker := time.NewTicker(c.interval)
+	defer ticker.Stop()
+
+	pending := make(map[string]int64)
+	for {
+		select {
+		case code := <-c.clicks:
+			pending[code]++
+		case <-ticker.C:
+			c.flush(pending)
+		case <-c.done:
+			// 退出前处理队列中剩余的点击
+			for {
+				select {
+				case code := <-c.clicks:
+					pending[code]++
+				default:
+					c.flush(pending)
+					return
+				}
+			}
+		}
+	}
+}
+
+func (c *clickRecorder) flush(pending map[string]int64) {
+	for code, count := range pending {
+		if err := c.store.AddClicks(code, count); err != nil {
+			log.Printf("Failed to update click count for %s: %v\n", code, err)
+		}
+		delete(pending, code)
+	}
+}
+
+// Stop 停止后台任务并等待剩余计数写入数据库
+func (c *clickRecorder) Stop() {
+	close(c.done)
+	c.wg.Wait()
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/magiconair/properties"
+)
+
+// config 在 config.properties 之上叠加环境变量，环境变量优先。
+// 配置项 db.password 对应的环境变量为 DB_PASSWORD。
+type config struct {
+	props *properties.Properties
+}
+
+var envKeyReplacer = strings.NewReplacer(".", "_", "-", "_")
+
+// loadConfig 读取配置文件，文件不存在时只使用默认值和环境变量
+func loadConfig(filename string) *config {
+	props, err := properties.LoadFiles([]string{filename}, properties.UTF8, true)
+	if err != nil {
+		log.Fatalf("Failed to load %s: %v\n", filename, err)
+	}
+	return &config{props: props}
+}
+
+func envName(key string) string {
+	return strings.ToUpper(envKeyReplacer.Replace(key))
+}
+
+func (c *config) lookup(key string) (string, bool) {
+	if value, ok := os.LookupEnv(envName(key)); ok {
+		return value, true
+	}
+	return c.props.Get(key)
+}
+
+func (c *config) GetString(key, def string) string {
+	if value, ok := c.lookup(key); ok {
+		return value
+	}
+	return def
+}
+
+func (c *config) GetInt(key string, def int) int {
+	value, ok := c.lookup(key)
+	if !ok {
+		return def
+	}
+	n, err := strconv.Atoi(strings.TrimSpace(value))
+	if err != nil {
+		log.Printf("Invalid integer for %s, using default %d\n", key, def)
+		return def
+	}
+	return n
+}
+
+func (c *config) GetBool(key string, def bool) bool {
+	value, ok := c.lookup(key)
+	if !ok {
+		return def
+	}
+	b, err := strconv.ParseBool(strings.TrimSpace(value))
+	if err != nil {
+		log.Printf("Invalid boolean for %s, using default %t\n", key, def)
+		return def
+	}
+	return b
+}
+
+func (c *config) GetParsedDuration(key string, def time.Duration) time.Duration {
+	value, ok := c.lookup(key)
+	if !ok {
+		return def
+	}
+	d, err := time.ParseDuration(strings.TrimSpace(value))
+	if err != nil {
+		log.Printf("Invalid duration for %s, using default %s\n", key, def)
+		return def
+	}
+	return d
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"log/slog"
+	"net/http"
+	"os"
+	"time"
+)
+
+var requestLogger = slog.New(slog.NewTextHandler(os.Stderr, nil))
+
+// statusRecorder 记录处理函数写入的状态码，以及创建接口生成的短码
+type statusRecorder struct {
+	http.ResponseWriter
+	status    int
+	shortCode string
+}
+
+func (rec *statusRecorder) WriteHeader(status int) {
+	rec.status = status
+	rec.ResponseWriter.WriteHeader(status)
+}
+
+func (rec *statusRecorder) Unwrap() http.ResponseWriter {
+	return rec.ResponseWriter
+}
+
+// setLogShortCode 把创建出的短码附加到当前请求的日志中
+func setLogShortCode(w http.ResponseWriter, shortCode string) {
+	if rec, ok := w.(*statusRecorder); ok {
+		rec.shortCode = shortCode
+	}
+}
+
+func newRequestLogger(format string) *slog.Logger {
+	if format == "json" {
+		return slog.New(slog.NewJSONHandler(os.Stderr, nil))
+	}
+	return slog.New(slog.NewTextHandler(os.Stderr, nil))
+}
+
+// logRequests 为每个请求输出一行结构化日志
+func logRequests(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		rec := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(rec, r)
+
+		attrs := []any{
+			"method", r.Method,
+			"path", r.URL.Path,
+			"status", rec.status,
+			"latency", time.Since(start),
+			"client_ip", clientIP(r),
+		}
+		if rec.shortCode != "" {
+			attrs = append(attrs, "short_code", rec.shortCode)
+		}
+
+		// 探针请求频繁且无排查价值，只在 debug 级别输出
+		level := slog.LevelInfo
+		if r.URL.Path == "/healthz" || r.URL.Path == "/readyz" {
+			level = slog.LevelDebug
+		}
+		requestLogger.Log(r.Context(), level, "request", attrs...)
+	})
+}
@@ -2,79 +2,157 @@ package main
 
 import (
 	"context"
+	"crypto/rand"
+	"crypto/subtle"
 	"database/sql"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"net/http"
 	"net/url"
 	"os"
 	"os/signal"
+	"regexp"
+	"sort"
+	"strconv"
 	"strings"
-	"sync"
+	"sync/atomic"
+	"syscall"
 	"time"
 	"net"
-
-	_ "github.com/go-sql-driver/mysql"
-	"github.com/magiconair/properties"
-	"github.com/teris-io/shortid"
 )
 
-var db *sql.DB
-var dbMutex sync.Mutex
+var store Store
 var domain string
 var adminKey string
+var redirectMaxHops int
+var trackingParams map[string]bool
+var allowPrivateHosts bool
+var redirectTimeout time.Duration
+var bulkMaxSize int
+var infoRequireAdmin bool
+
+var (
+	errRedirectLoop     = errors.New("redirect loop detected")
+	errTooManyRedirects = errors.New("too many redirects")
+	errUnsafeRedirect   = errors.New("redirected to an invalid URL")
+	errPrivateAddress   = errors.New("host resolves to a private address")
+)
 
-type ShortURL struct {
-	ID        int64
-	ShortCode string
-	LongURL   string
+// resolveTransport 在拨号时检查实际连接的 IP，避免 DNS 重绑定绕过 validateURL 的检查。
+// 不读取代理环境变量，确保请求直接连向校验过的地址。
+var resolveTransport = &http.Transport{
+	Proxy: nil,
+	DialContext: (&net.Dialer{
+		Timeout:   10 * time.Second,
+		KeepAlive: 30 * time.Second,
+		Control:   checkDialAddress,
+	}).DialContext,
+	ForceAttemptHTTP2:   true,
+	MaxIdleConns:        100,
+	IdleConnTimeout:     90 * time.Second,
+	TLSHandshakeTimeout: 10 * time.Second,
 }
 
-func initDB(db *sql.DB) error {
-	createTableSQL := `
-		CREATE TABLE IF NOT EXISTS short_urls (
-        id INT AUTO_INCREMENT PRIMARY KEY,
-        short_code VARCHAR(255) UNIQUE NOT NULL,
-        long_url TEXT NOT NULL
-    );
-    `
-
-	_, err := db.Exec(createTableSQL)
-	return err
+// 默认需要移除的跟踪参数，此外所有以 utm_ 开头的参数都会被移除
+var defaultTrackingParams = []string{
+	"gclid", "gclsrc", "dclid", "fbclid", "msclkid", "yclid", "igshid",
+	"mc_cid", "mc_eid", "_ga", "_gl", "_hsenc", "_hsmi", "mkt_tok",
 }
 
-func main() {
-	p := properties.MustLoadFile("config.properties", properties.UTF8)
+// 自定义短码只允许字母、数字、连字符和下划线
+var customCodePattern = regexp.MustCompile(`^[A-Za-z0-9_-]{1,64}$`)
+
+// 与路由冲突的保留路径不能作为短码
+var reservedCodes = map[string]bool{
+	"api":     true,
+	"healthz": true,
+	"readyz":  true,
+}
 
-	dbDriver := p.GetString("db.driver", "mysql")
-	dbUser := p.GetString("db.user", "root")
-	dbPass := p.GetString("db.password", "")
-	dbHost := p.GetString("db.host", "localhost")
-	dbPort := p.GetInt("db.port", 3306)
-	dbName := p.GetString("db.name", "shorter")
+type ShortURL struct {
+	ID         int64
+	ShortCode  string
+	LongURL    string
+	ClickCount int64
+	ExpiresAt  sql.NullTime
+	// RedirectType 为跳转时使用的状态码，301 或 302
+	RedirectType int
+	CreatedAt    time.Time
+}
 
-	dbSource := fmt.Sprintf("%s:%s@tcp(%s:%d)/%s", dbUser, dbPass, dbHost, dbPort, dbName)
+func main() {
+	p := loadConfig("config.properties")
 
 	var err error
-	db, err = sql.Open(dbDriver, dbSource)
+	store, err = openStore(p)
 	if err != nil {
 		log.Fatal(err)
 	}
-	defer db.Close()
+	defer store.Close()
 
-	if err := db.Ping(); err != nil {
-		log.Fatalf("Database connection failed: %v\n", err)
+	// 创建接口会发起外部请求并写库，按客户端 IP 限流
+	createHandler := handleCreateShortURL
+	bulkMaxSize = p.GetInt("bulk.max_size", 1000)
+	if rpm := p.GetInt("ratelimit.requests_per_minute", 30); rpm > 0 {
+		limiter, err := newRateLimiter(rpm, p.GetInt("ratelimit.burst", 10))
+		if err != nil {
+			log.Fatalf("Invalid ratelimit settings: %v\n", err)
+		}
+		createHandler = limiter.limit(createHandler)
 	}
-
-	if err := initDB(db); err != nil {
-		log.Fatal(err)
+	// 批量接口按条目数单独限流，默认突发量允许一次提交 bulk.max_size 条，0 表示不限流
+	if epm := p.GetInt("ratelimit.bulk_entries_per_minute", 1000); epm > 0 {
+		bulkLimiter, err = newRateLimiter(epm, p.GetInt("ratelimit.bulk_burst", bulkMaxSize))
+		if err != nil {
+			log.Fatalf("Invalid ratelimit.bulk settings: %v\n", err)
+		}
+	}
+	trustedProxies, err = parseTrustedProxies(p.GetString("proxy.trusted", ""))
+	if err != nil {
+		log.Fatalf("Invalid proxy.trusted: %v\n", err)
 	}
 
 	http.HandleFunc("/", handleShortURL)
-	http.HandleFunc("/api/create", handleCreateShortURL)
+	http.HandleFunc("/api/create", createHandler)
 	http.HandleFunc("/api/delete/", handleDeleteShortURL)
+	http.HandleFunc("/api/clicks/", handleClickCount)
+	http.HandleFunc("/api/bulk", handleBulkCreateShortURL)
+	http.HandleFunc("/api/qr/", handleQRCode)
+	http.HandleFunc("/api/info/", handleShortURLInfo)
+	http.HandleFunc("/api/list", handleListShortURLs)
+	http.HandleFunc("/healthz", handleHealthz)
+	http.HandleFunc("/readyz", handleReadyz)
+
+	clicks := startClickRecorder(store, time.Second)
+
+	// 定期清理已过期的短链接，间隔为 0 时不启动
+	stopSweeper := make(chan struct{})
+	if interval := p.GetParsedDuration("expiry.sweep_interval", time.Hour); interval > 0 {
+		go sweepExpiredURLs(store, interval, stopSweeper)
+	}
 
 	adminKey = p.GetString("admin.key", "DEFAULT_KEY")
+	if adminKey == "DEFAULT_KEY" && !p.GetBool("admin.allow_default_key", false) {
+		log.Fatal("admin.key is set to the insecure default; change it or set admin.allow_default_key=true")
+	}
+	redirectMaxHops = p.GetInt("redirect.max_hops", 10)
+	allowPrivateHosts = p.GetBool("security.allow_private_hosts", false)
+	redirectTimeout = time.Duration(p.GetInt("redirect.timeout_seconds", 10)) * time.Second
+	requestLogger = newRequestLogger(p.GetString("log.format", "plain"))
+	infoRequireAdmin = p.GetBool("info.require_admin", false)
+	unifyScheme = p.GetBool("normalize.unify_scheme", false)
+	shortCodeLength = p.GetInt("shortcode.length", 7)
+	if shortCodeLength < 1 || shortCodeLength > 64 {
+		log.Fatal("shortcode.length must be between 1 and 64")
+	}
+	notFoundRedirect = p.GetString("notfound.redirect", "")
+	homepageURL = p.GetString("main.homepage", "")
+	if err := loadNotFoundTemplate(p.GetString("notfound.template", "")); err != nil {
+		log.Fatalf("Failed to load notfound.template: %v\n", err)
+	}
+	trackingParams = parseParamList(p.GetString("query.blocklist", strings.Join(defaultTrackingParams, ",")))
 
     // 获取端口号和域名
     port := fmt.Sprintf(":%d", p.GetInt("main.port", 8080))
@@ -87,7 +165,13 @@ func main() {
     }
 
     // 启动 HTTP 服务器
-    server := &http.Server{Handler: nil}
+    // 所有请求的 context 都派生自 baseCtx，关闭超时后取消它以中止仍在进行的外部请求
+    baseCtx, cancelBase := context.WithCancel(context.Background())
+    defer cancelBase()
+    server := &http.Server{
+        Handler:     logRequests(countInFlight(http.DefaultServeMux)),
+        BaseContext: func(net.Listener) context.Context { return baseCtx },
+    }
     go func() {
         log.Printf("Server listening on port %s...\n", port)
         if err := server.Serve(listener); err != nil && err != http.ErrServerClosed {
@@ -96,139 +180,728 @@ func main() {
     }()
 
 	quit := make(chan os.Signal, 1)
-	signal.Notify(quit, os.Interrupt)
+	// docker stop 和 Kubernetes 发送的是 SIGTERM
+	signal.Notify(quit, os.Interrupt, syscall.SIGTERM)
 	<-quit
 	log.Println("Shutting down server...")
 
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	ctx, cancel := context.WithTimeout(context.Background(), p.GetParsedDuration("main.shutdown_timeout", 5*time.Second))
 	defer cancel()
 	if err := server.Shutdown(ctx); err != nil {
-		log.Fatal("Server forced to shutdown:", err)
+		log.Printf("Server forced to shutdown with %d requests still in flight: %v\n", inFlight.Load(), err)
+		cancelBase()
+		server.Close()
+		// Close 不等待处理函数返回，等它们退出后再关闭点击记录和数据库
+		if !waitInFlight(forceCloseWait) {
+			log.Printf("Closing store with %d requests still in flight\n", inFlight.Load())
+		}
 	}
+	close(stopSweeper)
+	clicks.Stop()
 
 	log.Println("Server exiting")
 }
 
+// inFlight 记录正在处理的请求数，用于关闭服务器时输出日志
+var inFlight atomic.Int64
+
+// 强制关闭后等待处理函数退出的最长时间
+const forceCloseWait = 2 * time.Second
+
+// waitInFlight 等待所有请求处理完毕，超时返回 false
+func waitInFlight(timeout time.Duration) bool {
+	deadline := time.Now().Add(timeout)
+	for inFlight.Load() > 0 {
+		if time.Now().After(deadline) {
+			return false
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	return true
+}
+
+func countInFlight(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		inFlight.Add(1)
+		defer inFlight.Add(-1)
+		next.ServeHTTP(w, r)
+	})
+}
+
+// handleHealthz 是存活探针，进程能响应即返回 200
+func handleHealthz(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	fmt.Fprint(w, `{"status": "ok"}`)
+}
+
+// handleReadyz 是就绪探针，复用连接池检查数据库是否可用
+func handleReadyz(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 2*time.Second)
+	defer cancel()
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := store.Ping(ctx); err != nil {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		fmt.Fprint(w, `{"status": "unavailable", "database": "unreachable"}`)
+		return
+	}
+	fmt.Fprint(w, `{"status": "ok", "database": "ok"}`)
+}
+
 func handleShortURL(w http.ResponseWriter, r *http.Request) {
 	shortCode := strings.TrimPrefix(r.URL.Path, "/")
 	if shortCode == "" {
-		http.NotFound(w, r)
+		// 根路径没有短码，配置了主页时跳转到主页
+		if homepageURL != "" {
+			http.Redirect(w, r, homepageURL, http.StatusFound)
+			return
+		}
+		handleNotFound(w, r, "")
+		return
+	}
+
+	shortURL, err := store.GetByCode(shortCode)
+	if err == errNotFound {
+		handleNotFound(w, r, shortCode)
+		return
+	} else if err != nil {
+		// 数据库故障不能伪装成 404，否则会触发回退跳转并被缓存
+		http.Error(w, "Failed to look up short URL", http.StatusInternalServerError)
+		return
+	}
+
+	if shortURL.ExpiresAt.Valid && time.Now().After(shortURL.ExpiresAt.Time) {
+		http.Error(w, "Short URL has expired", http.StatusGone)
+		return
+	}
+
+	recordClick(shortURL.ShortCode)
+	http.Redirect(w, r, shortURL.LongURL, shortURL.RedirectType)
+}
+
+// shortURLInfo 是短链接详情接口返回的 JSON 结构
+type shortURLInfo struct {
+	ShortCode  string     `json:"short_code"`
+	ShortURL   string     `json:"short_url"`
+	LongURL    string     `json:"long_url"`
+	ClickCount int64      `json:"click_count"`
+	Permanent  bool       `json:"permanent"`
+	CreatedAt  time.Time  `json:"created_at"`
+	ExpiresAt  *time.Time `json:"expires_at,omitempty"`
+}
+
+func newShortURLInfo(shortURL ShortURL) shortURLInfo {
+	info := shortURLInfo{
+		ShortCode:  shortURL.ShortCode,
+		ShortURL:   domain + "/" + shortURL.ShortCode,
+		LongURL:    shortURL.LongURL,
+		ClickCount: shortURL.ClickCount,
+		Permanent:  shortURL.RedirectType == http.StatusMovedPermanently,
+		CreatedAt:  shortURL.CreatedAt,
+	}
+	if shortURL.ExpiresAt.Valid {
+		info.ExpiresAt = &shortURL.ExpiresAt.Time
+	}
+	return info
+}
+
+// handleShortURLInfo 返回短链接的详情而不执行跳转
+func handleShortURLInfo(w http.ResponseWriter, r *http.Request) {
+	if infoRequireAdmin && !isAdmin(r) {
+		writeJSONError(w, http.StatusUnauthorized, "unauthorized", "Unauthorized")
+		return
+	}
+
+	shortCode := strings.TrimPrefix(r.URL.Path, "/api/info/")
+	if shortCode == "" {
+		writeJSONError(w, http.StatusNotFound, "missing_short_code", "Missing short code")
 		return
 	}
 
-	var shortURL ShortURL
-	err := db.QueryRow("SELECT id, short_code, long_url FROM short_urls WHERE short_code = ?", shortCode).Scan(&shortURL.ID, &shortURL.ShortCode, &shortURL.LongURL)
+	shortURL, err := store.GetByCode(shortCode)
+	if err == errNotFound {
+		writeJSONError(w, http.StatusNotFound, "not_found", "Short URL not found")
+		return
+	} else if err != nil {
+		writeJSONError(w, http.StatusInternalServerError, "database_error", "Failed to look up short URL")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(newShortURLInfo(shortURL))
+}
+
+const (
+	defaultListLimit = 50
+	maxListLimit     = 500
+)
+
+// handleListShortURLs 按创建时间倒序分页列出所有短链接，仅管理员可用
+func handleListShortURLs(w http.ResponseWriter, r *http.Request) {
+	if !isAdmin(r) {
+		writeJSONError(w, http.StatusUnauthorized, "unauthorized", "Unauthorized")
+		return
+	}
+
+	limit, err := queryInt(r, "limit", defaultListLimit)
+	if err != nil || limit <= 0 || limit > maxListLimit {
+		writeJSONError(w, http.StatusBadRequest, "invalid_limit", "limit must be between 1 and "+strconv.Itoa(maxListLimit))
+		return
+	}
+	offset, err := queryInt(r, "offset", 0)
+	if err != nil || offset < 0 {
+		writeJSONError(w, http.StatusBadRequest, "invalid_offset", "offset must not be negative")
+		return
+	}
+
+	shortURLs, total, err := store.List(limit, offset)
 	if err != nil {
-		http.NotFound(w, r)
+		writeJSONError(w, http.StatusInternalServerError, "database_error", "Failed to list short URLs")
+		return
+	}
+
+	items := make([]shortURLInfo, 0, len(shortURLs))
+	for _, shortURL := range shortURLs {
+		items = append(items, newShortURLInfo(shortURL))
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]any{
+		"total":  total,
+		"limit":  limit,
+		"offset": offset,
+		"items":  items,
+	})
+}
+
+func queryInt(r *http.Request, key string, def int) (int, error) {
+	value := r.URL.Query().Get(key)
+	if value == "" {
+		return def, nil
+	}
+	return strconv.Atoi(value)
+}
+
+func handleClickCount(w http.ResponseWriter, r *http.Request) {
+	shortCode := strings.TrimPrefix(r.URL.Path, "/api/clicks/")
+	if shortCode == "" {
+		writeJSONError(w, http.StatusNotFound, "missing_short_code", "Missing short code")
+		return
+	}
+
+	shortURL, err := store.GetByCode(shortCode)
+	if err == errNotFound {
+		writeJSONError(w, http.StatusNotFound, "not_found", "Short URL not found")
+		return
+	} else if err != nil {
+		writeJSONError(w, http.StatusInternalServerError, "database_error", "Failed to query click count")
 		return
 	}
 
-	http.Redirect(w, r, shortURL.LongURL, http.StatusMovedPermanently)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]any{
+		"short_code":  shortURL.ShortCode,
+		"click_count": shortURL.ClickCount,
+	})
 }
 func handleCreateShortURL(w http.ResponseWriter, r *http.Request) {
-    longURL := r.FormValue("long_url")
-    if longURL == "" {
-        http.Error(w, `{"error": "Missing long_url parameter"}`, http.StatusBadRequest)
-        return
-    }
+	longURL := r.FormValue("long_url")
+	if longURL == "" {
+		writeJSONError(w, http.StatusBadRequest, "missing_long_url", "Missing long_url parameter")
+		return
+	}
 
-    finalURL, err := getFinalURL(longURL)
-    if err != nil {
-        http.Error(w, `{"error": "Failed to resolve redirection"}`, http.StatusInternalServerError)
-        return
-    }
+	customCode := r.FormValue("custom_code")
+	if customCode != "" && !isValidCustomCode(customCode) {
+		writeJSONError(w, http.StatusBadRequest, "invalid_custom_code", "Invalid custom_code parameter")
+		return
+	}
 
-    cleanURL := removeQueryParams(finalURL)
-    shortCode := generateShortCode()
-
-    dbMutex.Lock()
-    defer dbMutex.Unlock()
-
-    var existingShortCode string
-    err = db.QueryRow("SELECT short_code FROM short_urls WHERE long_url = ?", cleanURL).Scan(&existingShortCode)
-    if err == nil {
-        // 短链接已存在，直接返回
-        w.Header().Set("Content-Type", "application/json")
-        fmt.Fprintf(w, `{"short_url": "%s"}`, domain+"/"+existingShortCode)
-        return
-    } else if err != sql.ErrNoRows {
-        http.Error(w, `{"error": "Failed to check for existing short URL"}`, http.StatusInternalServerError)
-        return
-    }
+	var expiresAt sql.NullTime
+	if value := r.FormValue("expires_at"); value != "" {
+		t, err := parseExpiresAt(value)
+		if err != nil {
+			writeJSONError(w, http.StatusBadRequest, "invalid_expires_at", "Invalid expires_at parameter")
+			return
+		}
+		expiresAt = sql.NullTime{Time: t.UTC(), Valid: true}
+	}
 
-    _, err = db.Exec("INSERT INTO short_urls (short_code, long_url) VALUES (?, ?)", shortCode, cleanURL)
-    if err != nil {
-        http.Error(w, `{"error": "Failed to create short URL"}`, http.StatusInternalServerError)
-        return
-    }
+	// 默认使用不会被缓存的 302，permanent=true 时使用 301
+	redirectType := http.StatusFound
+	if value := r.FormValue("permanent"); value != "" {
+		permanent, err := strconv.ParseBool(value)
+		if err != nil {
+			writeJSONError(w, http.StatusBadRequest, "invalid_permanent", "Invalid permanent parameter")
+			return
+		}
+		if permanent {
+			redirectType = http.StatusMovedPermanently
+		}
+	}
 
-    // 返回 JSON 格式的完整短链接
-    w.Header().Set("Content-Type", "application/json")
-    fmt.Fprintf(w, `{"short_url": "%s"}`, domain+"/"+shortCode)
+	overrides, err := parseParamOverrides(r.FormValue("keep_params"), r.FormValue("strip_params"))
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, "conflicting_params", err.Error())
+		return
+	}
+
+	cleanURL, cerr := resolveCleanURL(r.Context(), longURL, overrides)
+	if cerr != nil {
+		writeJSONError(w, cerr.status, cerr.code, cerr.message)
+		return
+	}
+
+	shortCode, cerr := insertShortURL(store, cleanURL, customCode, expiresAt, redirectType)
+	if cerr != nil {
+		writeJSONError(w, cerr.status, cerr.code, cerr.message)
+		return
+	}
+
+	setLogShortCode(w, shortCode)
+
+	// 返回 JSON 格式的完整短链接
+	w.Header().Set("Content-Type", "application/json")
+	fmt.Fprintf(w, `{"short_url": "%s"}`, domain+"/"+shortCode)
 }
 
+// createError 描述创建短链接失败的原因，单个创建和批量创建共用
+type createError struct {
+	status  int
+	code    string
+	message string
+}
+
+// resolveCleanURL 校验并解析重定向，返回去除跟踪参数后的最终地址
+// ctx 取消时（客户端断开或服务器关闭）会中止对外请求
+func resolveCleanURL(ctx context.Context, longURL string, overrides paramOverrides) (string, *createError) {
+	// 校验和解析共用一个超时，避免目标站点过慢拖住请求
+	ctx, cancel := context.WithTimeout(ctx, redirectTimeout)
+	defer cancel()
+
+	if err := validateURL(ctx, longURL); err != nil {
+		// 超时或取消不是地址本身的问题，按解析失败处理
+		if status, code := classifyResolveError(err); code == "resolve_timeout" || code == "resolve_cancelled" {
+			return "", &createError{status, code, "Failed to resolve long_url: " + err.Error()}
+		}
+		return "", &createError{http.StatusBadRequest, "invalid_url", "Invalid long_url: " + err.Error()}
+	}
+
+	finalURL, err := getFinalURL(ctx, longURL)
+	if err != nil {
+		status, code := classifyResolveError(err)
+		return "", &createError{status, code, "Failed to resolve long_url: " + err.Error()}
+	}
+
+	return normalizeURL(removeQueryParams(finalURL, overrides)), nil
+}
+
+// 生成的短码发生冲突时最多重试的次数
+const maxInsertAttempts = 5
+
+// insertShortURL 返回已存在的短码，或插入一条新记录并返回新短码。
+// 并发安全完全依赖存储层的唯一约束：短码冲突时重新生成，
+// 长链接冲突说明其他请求已创建了相同的链接，直接复用。
+func insertShortURL(s Store, cleanURL, customCode string, expiresAt sql.NullTime, redirectType int) (string, *createError) {
+	shortURL := ShortURL{LongURL: cleanURL, ExpiresAt: expiresAt, RedirectType: redirectType}
+	if customCode != "" {
+		// 自定义短码不复用已有记录，由 UNIQUE 约束保证不会重复
+		shortURL.ShortCode = customCode
+		err := s.Create(&shortURL, false)
+		if errors.Is(err, errCodeTaken) {
+			return "", &createError{http.StatusConflict, "custom_code_taken", "custom_code is already taken"}
+		} else if err != nil {
+			return "", &createError{http.StatusInternalServerError, "database_error", "Failed to create short URL"}
+		}
+		return customCode, nil
+	}
+
+	// 带有效期或永久跳转的短链接总是单独创建，不参与去重
+	dedup := !expiresAt.Valid && redirectType == http.StatusFound
+	if dedup {
+		existing, err := s.GetByLongURL(cleanURL)
+		if err == nil {
+			// 短链接已存在，直接返回
+			return existing.ShortCode, nil
+		} else if err != errNotFound {
+			return "", &createError{http.StatusInternalServerError, "database_error", "Failed to check for existing short URL"}
+		}
+	}
+
+	for attempt := 0; attempt < maxInsertAttempts; attempt++ {
+		shortCode, err := generateShortCode()
+		if err != nil {
+			return "", &createError{http.StatusInternalServerError, "short_code_error", "Failed to generate short code"}
+		}
+		shortURL.ShortCode = shortCode
+		err = s.Create(&shortURL, dedup)
+		switch {
+		case err == nil:
+			return shortURL.ShortCode, nil
+		case errors.Is(err, errURLExists):
+			existing, err := s.GetByLongURL(cleanURL)
+			if err == nil {
+				return existing.ShortCode, nil
+			} else if err != errNotFound {
+				return "", &createError{http.StatusInternalServerError, "database_error", "Failed to check for existing short URL"}
+			}
+			// 已存在的记录刚被删除，重新尝试插入
+		case errors.Is(err, errCodeTaken):
+			// short_code 冲突，重新生成
+		default:
+			return "", &createError{http.StatusInternalServerError, "database_error", "Failed to create short URL"}
+		}
+	}
+
+	return "", &createError{http.StatusInternalServerError, "short_code_exhausted", "Failed to generate a unique short code"}
+}
+
+// expires_at 支持 RFC3339 时间或相对当前时间的时长（如 72h）
+func parseExpiresAt(value string) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		if !t.After(time.Now()) {
+			return time.Time{}, errors.New("expires_at is in the past")
+		}
+		return t, nil
+	}
+
+	d, err := time.ParseDuration(value)
+	if err != nil {
+		return time.Time{}, err
+	}
+	if d <= 0 {
+		return time.Time{}, errors.New("expires_at duration must be positive")
+	}
+	return time.Now().Add(d), nil
+}
+
+func sweepExpiredURLs(s Store, interval time.Duration, stop <-chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			n, err := s.DeleteExpired(time.Now())
+			if err != nil {
+				log.Printf("Failed to sweep expired short URLs: %v\n", err)
+				continue
+			}
+			if n > 0 {
+				log.Printf("Swept %d expired short URLs\n", n)
+			}
+		case <-stop:
+			return
+		}
+	}
+}
+
+func isValidCustomCode(code string) bool {
+	return customCodePattern.MatchString(code) && !reservedCodes[strings.ToLower(code)]
+}
+
+
 
 func handleDeleteShortURL(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodDelete {
+		w.Header().Set("Allow", http.MethodDelete)
+		writeJSONError(w, http.StatusMethodNotAllowed, "method_not_allowed", "Only DELETE is allowed")
+		return
+	}
+
 	shortCode := strings.TrimPrefix(r.URL.Path, "/api/delete/")
-	key := r.Header.Get("Authorization")
-	if key != adminKey {
-		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+	if !isAdmin(r) {
+		writeJSONError(w, http.StatusUnauthorized, "unauthorized", "Unauthorized")
 		return
 	}
 
 	if shortCode == "" {
-		http.NotFound(w, r)
+		writeJSONError(w, http.StatusNotFound, "missing_short_code", "Missing short code")
 		return
 	}
 
-	_, err := db.Exec("DELETE FROM short_urls WHERE short_code = ?", shortCode)
-	if err != nil {
-		http.Error(w, "Failed to delete short URL", http.StatusInternalServerError)
+	err := store.Delete(shortCode)
+	if err == errNotFound {
+		writeJSONError(w, http.StatusNotFound, "not_found", "Short URL not found")
+		return
+	} else if err != nil {
+		writeJSONError(w, http.StatusInternalServerError, "database_error", "Failed to delete short URL")
 		return
 	}
 
-	w.WriteHeader(http.StatusOK)
-	fmt.Fprintf(w, "Short URL deleted: %s\n", domain+shortCode)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{
+		"deleted":   shortCode,
+		"short_url": domain + "/" + shortCode,
+	})
 }
 
-func generateShortCode() string {
-	return shortid.MustGenerate()
+// isAdmin 校验 Authorization 头中的管理密钥，支持 "Bearer <key>" 和直接传入密钥两种格式
+func isAdmin(r *http.Request) bool {
+	if adminKey == "" {
+		return false
+	}
+
+	key := r.Header.Get("Authorization")
+	if len(key) > 7 && strings.EqualFold(key[:7], "Bearer ") {
+		key = strings.TrimSpace(key[7:])
+	}
+	return subtle.ConstantTimeCompare([]byte(key), []byte(adminKey)) == 1
 }
 
-func getFinalURL(urlStr string) (string, error) {
+// 64 个 URL 安全字符，随机字节取低 6 位即可均匀映射
+const shortCodeAlphabet = "0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz-_"
+
+var shortCodeLength int
+
+// randRead 是短码的随机来源，测试中替换它以构造冲突
+var randRead = rand.Read
+
+// generateShortCode 使用 crypto/rand 生成随机短码，不会返回保留路径
+func generateShortCode() (string, error) {
+	buf := make([]byte, shortCodeLength)
+	for {
+		if _, err := randRead(buf); err != nil {
+			return "", err
+		}
+		for i, b := range buf {
+			buf[i] = shortCodeAlphabet[b&63]
+		}
+		if code := string(buf); !reservedCodes[strings.ToLower(code)] {
+			return code, nil
+		}
+	}
+}
+
+func getFinalURL(ctx context.Context, urlStr string) (string, error) {
 	client := &http.Client{
+		Transport: resolveTransport,
 		CheckRedirect: func(req *http.Request, via []*http.Request) error {
 			return http.ErrUseLastResponse
 		},
 	}
 
-	resp, err := client.Head(urlStr)
-	if err != nil {
-		return "", err
-	}
-	defer resp.Body.Close()
+	// 逐跳跟随重定向，记录访问过的 URL 以防止循环
+	visited := make(map[string]bool)
+	currentURL := urlStr
+	for hops := 0; ; hops++ {
+		if visited[currentURL] {
+			return "", fmt.Errorf("%w at %s", errRedirectLoop, currentURL)
+		}
+		visited[currentURL] = true
+
+		// 每一跳都要校验，防止被重定向到内网地址
+		if err := validateURL(ctx, currentURL); err != nil {
+			return "", fmt.Errorf("%w: %w", errUnsafeRedirect, err)
+		}
+
+		req, err := http.NewRequestWithContext(ctx, http.MethodHead, currentURL, nil)
+		if err != nil {
+			return "", err
+		}
+		resp, err := client.Do(req)
+		if err != nil {
+			return "", err
+		}
+		resp.Body.Close()
 
-	if isRedirect(resp.StatusCode) {
+		if !isRedirect(resp.StatusCode) {
+			return currentURL, nil
+		}
+		if hops >= redirectMaxHops {
+			return "", fmt.Errorf("%w (max %d)", errTooManyRedirects, redirectMaxHops)
+		}
+
+		// Location() 会基于当前请求的 URL 解析相对路径
 		locationURL, err := resp.Location()
 		if err != nil {
 			return "", err
 		}
-		return locationURL.String(), nil
+		currentURL = locationURL.String()
+	}
+}
+
+// validateURL 只允许 http/https，并拒绝解析到回环、链路本地或私有网段的主机
+func validateURL(ctx context.Context, urlStr string) error {
+	parsedURL, err := url.Parse(urlStr)
+	if err != nil {
+		return errors.New("malformed URL")
+	}
+	if parsedURL.Scheme != "http" && parsedURL.Scheme != "https" {
+		return errors.New("scheme must be http or https")
+	}
+	host := parsedURL.Hostname()
+	if host == "" {
+		return errors.New("missing host")
+	}
+	if allowPrivateHosts {
+		return nil
+	}
+
+	addrs, err := net.DefaultResolver.LookupIPAddr(ctx, host)
+	if err != nil {
+		// 保留超时和取消的原因，便于 classifyResolveError 区分
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return fmt.Errorf("host cannot be resolved: %w", ctxErr)
+		}
+		var dnsErr *net.DNSError
+		if errors.As(err, &dnsErr) && dnsErr.IsTimeout {
+			return fmt.Errorf("host cannot be resolved: %w", err)
+		}
+		return errors.New("host cannot be resolved")
+	}
+	for _, addr := range addrs {
+		if isPrivateIP(addr.IP) {
+			return errPrivateAddress
+		}
+	}
+	return nil
+}
+
+// checkDialAddress 作为 net.Dialer.Control，拒绝连接私有地址
+func checkDialAddress(network, address string, c syscall.RawConn) error {
+	if allowPrivateHosts {
+		return nil
+	}
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	if ip := net.ParseIP(host); ip == nil || isPrivateIP(ip) {
+		return errPrivateAddress
 	}
+	return nil
+}
+
+func isPrivateIP(ip net.IP) bool {
+	return ip.IsLoopback() || ip.IsPrivate() || ip.IsUnspecified() ||
+		ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() || ip.IsInterfaceLocalMulticast()
+}
 
-	return urlStr, nil
+// classifyResolveError 将解析失败映射为状态码和错误码，均属于用户提供的目标地址的问题
+func classifyResolveError(err error) (int, string) {
+	var netErr net.Error
+	switch {
+	case errors.Is(err, context.Canceled):
+		// 客户端已断开或服务器正在关闭
+		return http.StatusServiceUnavailable, "resolve_cancelled"
+	case errors.Is(err, context.DeadlineExceeded), errors.As(err, &netErr) && netErr.Timeout():
+		return http.StatusUnprocessableEntity, "resolve_timeout"
+	case errors.Is(err, errRedirectLoop):
+		return http.StatusUnprocessableEntity, "redirect_loop"
+	case errors.Is(err, errTooManyRedirects):
+		return http.StatusUnprocessableEntity, "too_many_redirects"
+	case errors.Is(err, errUnsafeRedirect), errors.Is(err, errPrivateAddress):
+		return http.StatusBadRequest, "invalid_url"
+	default:
+		return http.StatusUnprocessableEntity, "unreachable_url"
+	}
+}
+
+func writeJSONError(w http.ResponseWriter, status int, code, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]string{
+		"error": message,
+		"code":  code,
+	})
 }
 
 func isRedirect(statusCode int) bool {
 	return statusCode >= 300 && statusCode <= 399
 }
 
-func removeQueryParams(urlStr string) string {
+func removeQueryParams(urlStr string, overrides paramOverrides) string {
 	parsedURL, err := url.Parse(urlStr)
 	if err != nil {
 		return urlStr
 	}
 
-	parsedURL.RawQuery = ""
+	parsedURL.RawQuery = filterQuery(parsedURL.RawQuery, overrides.shouldStrip)
 	return parsedURL.String()
 }
+
+// filterQuery 按参数名过滤原始查询串中以 & 分隔的片段，strip 为 nil 时只排序。
+// 保留的片段原样输出并按解码后的参数名稳定排序，无法解码的片段不会被丢弃。
+func filterQuery(rawQuery string, strip func(key string) bool) string {
+	type pair struct {
+		key string
+		raw string
+	}
+
+	var pairs []pair
+	for _, raw := range strings.Split(rawQuery, "&") {
+		if raw == "" {
+			continue
+		}
+		key := queryKey(raw)
+		if strip != nil && strip(key) {
+			continue
+		}
+		pairs = append(pairs, pair{key, raw})
+	}
+
+	sort.SliceStable(pairs, func(i, j int) bool {
+		return pairs[i].key < pairs[j].key
+	})
+
+	raws := make([]string, len(pairs))
+	for i, p := range pairs {
+		raws[i] = p.raw
+	}
+	return strings.Join(raws, "&")
+}
+
+// queryKey 返回片段中 = 之前的参数名，无法解码时返回原始参数名
+func queryKey(raw string) string {
+	key, _, _ := strings.Cut(raw, "=")
+	if unescaped, err := url.QueryUnescape(key); err == nil {
+		return unescaped
+	}
+	return key
+}
+
+func isTrackingParam(key string) bool {
+	key = strings.ToLower(key)
+	return strings.HasPrefix(key, "utm_") || trackingParams[key]
+}
+
+// paramOverrides 是单次请求对默认黑名单的调整，keep 和 strip 不会同时包含同一个参数
+type paramOverrides struct {
+	keep  map[string]bool
+	strip map[string]bool
+}
+
+// parseParamOverrides 解析逗号分隔的 keep_params 和 strip_params，同一参数出现在两个列表中时返回错误
+func parseParamOverrides(keepList, stripList string) (paramOverrides, error) {
+	overrides := paramOverrides{
+		keep:  parseParamList(keepList),
+		strip: parseParamList(stripList),
+	}
+	for key := range overrides.keep {
+		if overrides.strip[key] {
+			return paramOverrides{}, fmt.Errorf("parameter %q appears in both keep_params and strip_params", key)
+		}
+	}
+	return overrides, nil
+}
+
+// shouldStrip 按 默认黑名单 - keep + strip 的顺序判断参数是否需要移除
+func (o paramOverrides) shouldStrip(key string) bool {
+	lower := strings.ToLower(key)
+	if o.keep[lower] {
+		return false
+	}
+	return o.strip[lower] || isTrackingParam(key)
+}
+
+func parseParamList(list string) map[string]bool {
+	params := make(map[string]bool)
+	for _, key := range strings.Split(list, ",") {
+		key = strings.ToLower(strings.TrimSpace(key))
+		if key != "" {
+			params[key] = true
+		}
+	}
+	return params
+}
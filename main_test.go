@@ -0,0 +1,240 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestMain(m *testing.M) {
+	// 与 main 中读取配置后的默认值保持一致
+	shortCodeLength = 7
+	trackingParams = parseParamList(strings.Join(defaultTrackingParams, ","))
+	os.Exit(m.Run())
+}
+
+// stubRandRead 让第 n 次调用把所有字节填为 values[n]，超出后重复最后一个值，
+// 字节 b 对应短码字符 shortCodeAlphabet[b]
+func stubRandRead(t *testing.T, values ...byte) *int {
+	t.Helper()
+	calls := 0
+	orig := randRead
+	randRead = func(buf []byte) (int, error) {
+		v := values[min(calls, len(values)-1)]
+		calls++
+		for i := range buf {
+			buf[i] = v
+		}
+		return len(buf), nil
+	}
+	t.Cleanup(func() { randRead = orig })
+	return &calls
+}
+
+func TestInsertShortURLRetriesOnCollision(t *testing.T) {
+	s := newTestStore(t)
+	if err := s.Create(&ShortURL{ShortCode: "AAAAAAA", LongURL: "https://example.com/seed", RedirectType: http.StatusFound}, false); err != nil {
+		t.Fatalf("seed: %v", err)
+	}
+	calls := stubRandRead(t, 10, 11)
+
+	code, cerr := insertShortURL(s, "https://example.com/new", "", sql.NullTime{}, http.StatusFound)
+	if cerr != nil {
+		t.Fatalf("insertShortURL: %+v", cerr)
+	}
+	if code != "BBBBBBB" {
+		t.Errorf("code = %q, want %q", code, "BBBBBBB")
+	}
+	if *calls != 2 {
+		t.Errorf("generated %d codes, want 2", *calls)
+	}
+	if got, err := s.GetByCode(code); err != nil || got.LongURL != "https://example.com/new" {
+		t.Errorf("GetByCode(%q) = %+v, %v", code, got, err)
+	}
+}
+
+func TestInsertShortURLExhausted(t *testing.T) {
+	s := newTestStore(t)
+	if err := s.Create(&ShortURL{ShortCode: "AAAAAAA", LongURL: "https://example.com/seed", RedirectType: http.StatusFound}, false); err != nil {
+		t.Fatalf("seed: %v", err)
+	}
+	calls := stubRandRead(t, 10)
+
+	_, cerr := insertShortURL(s, "https://example.com/new", "", sql.NullTime{}, http.StatusFound)
+	if cerr == nil {
+		t.Fatal("insertShortURL succeeded, want short_code_exhausted")
+	}
+	if cerr.status != http.StatusInternalServerError || cerr.code != "short_code_exhausted" {
+		t.Errorf("error = %d %s, want 500 short_code_exhausted", cerr.status, cerr.code)
+	}
+	if *calls != maxInsertAttempts {
+		t.Errorf("generated %d codes, want %d", *calls, maxInsertAttempts)
+	}
+}
+
+func TestInsertShortURLConcurrentDedup(t *testing.T) {
+	s := newTestStore(t)
+
+	const n = 20
+	codes := make([]string, n)
+	errs := make([]*createError, n)
+	var wg sync.WaitGroup
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			codes[i], errs[i] = insertShortURL(s, "https://example.com/same", "", sql.NullTime{}, http.StatusFound)
+		}(i)
+	}
+	wg.Wait()
+
+	for i := range codes {
+		if errs[i] != nil {
+			t.Fatalf("goroutine %d: %+v", i, errs[i])
+		}
+		if codes[i] != codes[0] {
+			t.Errorf("goroutine %d got code %q, goroutine 0 got %q", i, codes[i], codes[0])
+		}
+	}
+
+	_, total, err := s.List(10, 0)
+	if err != nil {
+		t.Fatalf("List: %v", err)
+	}
+	if total != 1 {
+		t.Errorf("total = %d, want 1", total)
+	}
+}
+
+// lostRaceStore 让第一次 GetByLongURL 查不到记录，模拟另一个请求在查询之后、
+// 插入之前创建了相同的长链接
+type lostRaceStore struct {
+	Store
+	lookups int
+}
+
+func (s *lostRaceStore) GetByLongURL(longURL string) (ShortURL, error) {
+	s.lookups++
+	if s.lookups == 1 {
+		return ShortURL{}, errNotFound
+	}
+	return s.Store.GetByLongURL(longURL)
+}
+
+func TestInsertShortURLLostRace(t *testing.T) {
+	s := &lostRaceStore{Store: newTestStore(t)}
+	if err := s.Create(&ShortURL{ShortCode: "seeded1", LongURL: "https://example.com/same", RedirectType: http.StatusFound}, true); err != nil {
+		t.Fatalf("seed: %v", err)
+	}
+
+	code, cerr := insertShortURL(s, "https://example.com/same", "", sql.NullTime{}, http.StatusFound)
+	if cerr != nil {
+		t.Fatalf("insertShortURL: %+v", cerr)
+	}
+	if code != "seeded1" {
+		t.Errorf("code = %q, want %q", code, "seeded1")
+	}
+	if s.lookups != 2 {
+		t.Errorf("GetByLongURL called %d times, want 2", s.lookups)
+	}
+
+	_, total, err := s.List(10, 0)
+	if err != nil {
+		t.Fatalf("List: %v", err)
+	}
+	if total != 1 {
+		t.Errorf("total = %d, want 1", total)
+	}
+}
+
+func TestParseParamOverrides(t *testing.T) {
+	tests := []struct {
+		name      string
+		keep      string
+		strip     string
+		wantKeep  map[string]bool
+		wantStrip map[string]bool
+		wantErr   bool
+	}{
+		{"empty", "", "", map[string]bool{}, map[string]bool{}, false},
+		{"trimmed and lowercased", " GCLID , utm_Source", "Ref,,", map[string]bool{"gclid": true, "utm_source": true}, map[string]bool{"ref": true}, false},
+		{"conflict", "id", "id", nil, nil, true},
+		{"conflict ignores case", "id", "ID", nil, nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseParamOverrides(tt.keep, tt.strip)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("err = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if !reflect.DeepEqual(got.keep, tt.wantKeep) || !reflect.DeepEqual(got.strip, tt.wantStrip) {
+				t.Errorf("got keep %v strip %v, want keep %v strip %v", got.keep, got.strip, tt.wantKeep, tt.wantStrip)
+			}
+		})
+	}
+}
+
+func TestRemoveQueryParams(t *testing.T) {
+	tests := []struct {
+		name  string
+		in    string
+		keep  string
+		strip string
+		want  string
+	}{
+		{"default blocklist", "https://example.com/p?gclid=x&a=1&utm_source=y", "", "", "https://example.com/p?a=1"},
+		{"all params removed", "https://example.com/p?utm_source=y", "", "", "https://example.com/p"},
+		{"keep overrides default key", "https://example.com/p?gclid=x&a=1", "gclid", "", "https://example.com/p?a=1&gclid=x"},
+		{"keep overrides utm_ prefix", "https://example.com/p?utm_source=y&utm_medium=z&a=1", "utm_source", "", "https://example.com/p?a=1&utm_source=y"},
+		{"strip key not on blocklist", "https://example.com/p?ref=home&a=1", "", "ref", "https://example.com/p?a=1"},
+		{"default matching ignores case", "https://example.com/p?UTM_Source=y&GClid=x&a=1", "", "", "https://example.com/p?a=1"},
+		{"keep ignores case", "https://example.com/p?GClid=x&a=1", "GCLID", "", "https://example.com/p?GClid=x&a=1"},
+		{"strip ignores case", "https://example.com/p?REF=home&a=1", "", "Ref", "https://example.com/p?a=1"},
+		{"undecodable pair kept", "https://example.com/p?a=%zz&utm_source=y", "", "", "https://example.com/p?a=%zz"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			overrides, err := parseParamOverrides(tt.keep, tt.strip)
+			if err != nil {
+				t.Fatalf("parseParamOverrides: %v", err)
+			}
+			if got := removeQueryParams(tt.in, overrides); got != tt.want {
+				t.Errorf("removeQueryParams(%q) = %q, want %q", tt.in, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestHandleCreateShortURLConflictingParams(t *testing.T) {
+	form := url.Values{
+		"long_url":     {"https://example.com/p?id=1"},
+		"keep_params":  {"id"},
+		"strip_params": {"ID"},
+	}
+	req := httptest.NewRequest(http.MethodPost, "/api/create", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	rec := httptest.NewRecorder()
+
+	handleCreateShortURL(rec, req)
+
+	if rec.Code != http.StatusBadRequest {
+		t.Fatalf("status = %d, want %d", rec.Code, http.StatusBadRequest)
+	}
+	var body map[string]string
+	if err := json.NewDecoder(rec.Body).Decode(&body); err != nil {
+		t.Fatalf("decode body: %v", err)
+	}
+	if body["code"] != "conflicting_params" {
+		t.Errorf("code = %q, want %q", body["code"], "conflicting_params")
+	}
+}
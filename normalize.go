@@ -0,0 +1,106 @@
+package main
+
+import (
+	"net"
+	"net/url"
+	"strings"
+
+	"golang.org/x/net/idna"
+)
+
+// 为 true 时把 http 统一改写为 https，使两种协议的同一地址共用一个短码
+var unifyScheme bool
+
+// normalizeURL 把等价的链接规范化为同一个字符串，用于去重和存储。规则如下：
+//
+//   - 协议和主机名转为小写，国际化域名转换为 punycode（xn--）形式
+//   - 去掉默认端口（http 的 80、https 的 443）
+//   - 路径中表示非保留字符（字母、数字、-._~）的百分号编码被解码，
+//     其余百分号编码统一为大写十六进制，%2F 等保留字符的编码保持不变
+//   - 去掉路径末尾的斜杠，仅有 "/" 的路径视为空路径
+//   - 查询参数按解码后的参数名稳定排序，参数本身的编码规则与路径相同，
+//     无法解析的参数（如 "x=1;y=2"、没有等号的 "flag"）原样保留，空查询串被移除
+//   - unifyScheme 为 true 时 http 改写为 https
+//
+// 无法解析的链接原样返回。
+func normalizeURL(urlStr string) string {
+	parsedURL, err := url.Parse(urlStr)
+	if err != nil {
+		return urlStr
+	}
+
+	parsedURL.Scheme = strings.ToLower(parsedURL.Scheme)
+
+	host := strings.ToLower(parsedURL.Hostname())
+	if ascii, err := idna.Lookup.ToASCII(host); err == nil {
+		host = ascii
+	}
+	port := parsedURL.Port()
+	if (parsedURL.Scheme == "http" && port == "80") || (parsedURL.Scheme == "https" && port == "443") {
+		port = ""
+	}
+	// 默认端口按原协议判断之后再改写协议
+	if unifyScheme && parsedURL.Scheme == "http" {
+		parsedURL.Scheme = "https"
+	}
+	if port != "" {
+		parsedURL.Host = net.JoinHostPort(host, port)
+	} else if strings.Contains(host, ":") {
+		// IPv6 地址需要保留方括号
+		parsedURL.Host = "[" + host + "]"
+	} else {
+		parsedURL.Host = host
+	}
+
+	rawPath := strings.TrimRight(normalizePercentEncoding(parsedURL.EscapedPath()), "/")
+	if path, err := url.PathUnescape(rawPath); err == nil {
+		parsedURL.Path = path
+		parsedURL.RawPath = rawPath
+	}
+
+	parsedURL.RawQuery = filterQuery(normalizePercentEncoding(parsedURL.RawQuery), nil)
+	parsedURL.ForceQuery = false
+
+	return parsedURL.String()
+}
+
+// normalizePercentEncoding 解码非保留字符的百分号编码，其余编码改为大写十六进制
+func normalizePercentEncoding(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] != '%' || i+2 >= len(s) || !isHex(s[i+1]) || !isHex(s[i+2]) {
+			b.WriteByte(s[i])
+			continue
+		}
+
+		c := unhex(s[i+1])<<4 | unhex(s[i+2])
+		if isUnreserved(c) {
+			b.WriteByte(c)
+		} else {
+			b.WriteByte('%')
+			b.WriteString(strings.ToUpper(s[i+1 : i+3]))
+		}
+		i += 2
+	}
+	return b.String()
+}
+
+func isUnreserved(c byte) bool {
+	return 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' || '0' <= c && c <= '9' ||
+		c == '-' || c == '.' || c == '_' || c == '~'
+}
+
+func isHex(c byte) bool {
+	return '0' <= c && c <= '9' || 'a' <= c && c <= 'f' || 'A' <= c && c <= 'F'
+}
+
+func unhex(c byte) byte {
+	switch {
+	case '0' <= c && c <= '9':
+		return c - '0'
+	case 'a' <= c && c <= 'f':
+		return c - 'a' + 10
+	default:
+		return c - 'A' + 10
+	}
+}
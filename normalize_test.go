@@ -0,0 +1,48 @@
+package main
+
+import "testing"
+
+func TestNormalizeURL(t *testing.T) {
+	tests := []struct {
+		name  string
+		in    string
+		unify bool
+		want  string
+	}{
+		{"lowercase scheme and host", "HTTP://Example.COM/Path", false, "http://example.com/Path"},
+		{"default http port", "http://example.com:80/a", false, "http://example.com/a"},
+		{"default https port", "https://example.com:443/a", false, "https://example.com/a"},
+		{"non-default port kept", "http://example.com:8080/a", false, "http://example.com:8080/a"},
+		{"https port on http kept", "http://example.com:443/a", false, "http://example.com:443/a"},
+		{"trailing slash", "https://example.com/a/b/", false, "https://example.com/a/b"},
+		{"root path", "https://example.com/", false, "https://example.com"},
+		{"unreserved percent-encoding decoded", "https://example.com/%7euser/%41", false, "https://example.com/~user/A"},
+		{"reserved percent-encoding uppercased", "https://example.com/a%2fb%2Fc", false, "https://example.com/a%2Fb%2Fc"},
+		{"idn host", "https://Bücher.example/x", false, "https://xn--bcher-kva.example/x"},
+		{"ipv6 host", "http://[::1]/a", false, "http://[::1]/a"},
+		{"ipv6 default port", "http://[::1]:80/", false, "http://[::1]"},
+		{"ipv6 custom port", "http://[::1]:8080/", false, "http://[::1]:8080"},
+		{"query sorted", "https://example.com/?b=2&a=1", false, "https://example.com?a=1&b=2"},
+		{"query same key order kept", "https://example.com/?a=2&b=1&a=1", false, "https://example.com?a=2&a=1&b=1"},
+		{"query empty pieces removed", "https://example.com/?&b=2&&a=1&", false, "https://example.com?a=1&b=2"},
+		{"empty query removed", "https://example.com/a?", false, "https://example.com/a"},
+		{"query flag kept without equals", "https://example.com/?flag", false, "https://example.com?flag"},
+		{"query semicolon kept", "https://example.com/?x=1;y=2", false, "https://example.com?x=1;y=2"},
+		{"query plus kept", "https://example.com/?q=a+b", false, "https://example.com?q=a+b"},
+		{"query percent-encoding normalized", "https://example.com/?q=%7e%2f", false, "https://example.com?q=~%2F"},
+		{"unify http", "http://example.com/a", true, "https://example.com/a"},
+		{"unify strips http default port", "http://example.com:80/a", true, "https://example.com/a"},
+		{"unify keeps https", "https://example.com/a", true, "https://example.com/a"},
+		{"fragment kept", "https://example.com/a#Top", false, "https://example.com/a#Top"},
+		{"unparseable returned as is", "http://[::1", false, "http://[::1"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			unifyScheme = tt.unify
+			t.Cleanup(func() { unifyScheme = false })
+			if got := normalizeURL(tt.in); got != tt.want {
+				t.Errorf("normalizeURL(%q) = %q, want %q", tt.in, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"bytes"
+	"html/template"
+	"log"
+	"net/http"
+)
+
+// 未配置 notfound.template 时使用的默认页面
+const defaultNotFoundTemplate = `<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>Link not found</title>
+</head>
+<body>
+<h1>Link not found</h1>
+<p>The short link {{if .ShortCode}}<code>{{.ShortCode}}</code> {{end}}does not exist or has been removed.</p>
+<p><a href="{{.Domain}}">{{.Domain}}</a></p>
+</body>
+</html>
+`
+
+var notFoundTemplate = template.Must(template.New("notfound").Parse(defaultNotFoundTemplate))
+
+// 未知短码跳转的目标地址和根路径跳转的主页，为空时不跳转
+var notFoundRedirect string
+var homepageURL string
+
+// loadNotFoundTemplate 从文件加载自定义 404 页面，path 为空时保留默认页面
+func loadNotFoundTemplate(path string) error {
+	if path == "" {
+		return nil
+	}
+	tmpl, err := template.ParseFiles(path)
+	if err != nil {
+		return err
+	}
+	notFoundTemplate = tmpl
+	return nil
+}
+
+// handleNotFound 处理未知短码：配置了 notfound.redirect 时跳转，否则渲染 404 页面
+func handleNotFound(w http.ResponseWriter, r *http.Request, shortCode string) {
+	if notFoundRedirect != "" {
+		http.Redirect(w, r, notFoundRedirect, http.StatusFound)
+		return
+	}
+
+	// 先渲染到缓冲区，模板出错时不会输出半个页面
+	var buf bytes.Buffer
+	data := struct {
+		ShortCode string
+		Domain    string
+	}{shortCode, domain}
+	if err := notFoundTemplate.Execute(&buf, data); err != nil {
+		log.Printf("Failed to render 404 page: %v\n", err)
+		http.NotFound(w, r)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(http.StatusNotFound)
+	buf.WriteTo(w)
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/skip2/go-qrcode"
+)
+
+const (
+	defaultQRSize = 256
+	maxQRSize     = 1024
+)
+
+func handleQRCode(w http.ResponseWriter, r *http.Request) {
+	shortCode := strings.TrimPrefix(r.URL.Path, "/api/qr/")
+	if shortCode == "" {
+		writeJSONError(w, http.StatusNotFound, "missing_short_code", "Missing short code")
+		return
+	}
+
+	size := defaultQRSize
+	if value := r.URL.Query().Get("size"); value != "" {
+		n, err := strconv.Atoi(value)
+		if err != nil || n <= 0 || n > maxQRSize {
+			writeJSONError(w, http.StatusBadRequest, "invalid_size", "size must be between 1 and "+strconv.Itoa(maxQRSize))
+			return
+		}
+		size = n
+	}
+
+	shortURL, err := store.GetByCode(shortCode)
+	if err == errNotFound {
+		writeJSONError(w, http.StatusNotFound, "not_found", "Short URL not found")
+		return
+	} else if err != nil {
+		writeJSONError(w, http.StatusInternalServerError, "database_error", "Failed to look up short URL")
+		return
+	}
+	if shortURL.ExpiresAt.Valid && time.Now().After(shortURL.ExpiresAt.Time) {
+		writeJSONError(w, http.StatusGone, "expired", "Short URL has expired")
+		return
+	}
+
+	png, err := qrcode.Encode(domain+"/"+shortCode, qrcode.Medium, size)
+	if err != nil {
+		writeJSONError(w, http.StatusInternalServerError, "qr_error", "Failed to generate QR code")
+		return
+	}
+
+	// 短码对应的内容不会变化，允许浏览器和 CDN 缓存一天
+	w.Header().Set("Content-Type", "image/png")
+	w.Header().Set("Cache-Control", "public, max-age=86400")
+	w.Header().Set("Content-Length", strconv.Itoa(len(png)))
+	w.Write(png)
+}
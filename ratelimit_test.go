@@ -0,0 +1,45 @@
+package main
+
+import "testing"
+
+func TestNewRateLimiterRejectsNonPositive(t *testing.T) {
+	tests := []struct {
+		name  string
+		rpm   int
+		burst int
+	}{
+		{"zero rate", 0, 10},
+		{"negative rate", -1, 10},
+		{"zero burst", 30, 0},
+		{"negative burst", 30, -1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := newRateLimiter(tt.rpm, tt.burst); err == nil {
+				t.Errorf("newRateLimiter(%d, %d) succeeded, want error", tt.rpm, tt.burst)
+			}
+		})
+	}
+}
+
+func TestRateLimiterAllowN(t *testing.T) {
+	l, err := newRateLimiter(60, 10)
+	if err != nil {
+		t.Fatalf("newRateLimiter: %v", err)
+	}
+
+	if ok, _ := l.allowN("a", 8); !ok {
+		t.Fatal("first allowN(8) rejected")
+	}
+	ok, wait := l.allowN("a", 5)
+	if ok {
+		t.Fatal("allowN(5) with 2 tokens left succeeded")
+	}
+	// 每秒恢复一个令牌，还差约 3 个
+	if wait <= 0 || wait.Seconds() > 3 {
+		t.Errorf("wait = %v, want within (0, 3s]", wait)
+	}
+	if ok, _ := l.allowN("b", 10); !ok {
+		t.Error("other client shares the bucket")
+	}
+}
@@ -0,0 +1,198 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Store 封装短链接的持久化，处理函数只通过它访问数据库
+type Store interface {
+	// Create 插入一条新记录并回填 ID 和 CreatedAt。dedup 为 true 时该记录可被
+	// 相同的长链接复用。短码冲突返回 errCodeTaken，可复用记录已存在返回 errURLExists。
+	Create(shortURL *ShortURL, dedup bool) error
+	GetByCode(shortCode string) (ShortURL, error)
+	// GetByLongURL 返回可复用的记录，不存在时返回 errNotFound
+	GetByLongURL(longURL string) (ShortURL, error)
+	Delete(shortCode string) error
+	// List 按创建时间倒序返回一页记录以及记录总数
+	List(limit, offset int) ([]ShortURL, int64, error)
+	AddClicks(shortCode string, count int64) error
+	DeleteExpired(now time.Time) (int64, error)
+	// WithTx 在同一个事务中执行 fn，fn 返回错误时回滚
+	WithTx(fn func(tx Store) error) error
+	Ping(ctx context.Context) error
+	Close() error
+}
+
+var (
+	errNotFound  = errors.New("short URL not found")
+	errCodeTaken = errors.New("short code already exists")
+	errURLExists = errors.New("long URL already shortened")
+)
+
+// openStore 根据 db.driver 选择存储实现
+func openStore(p *config) (Store, error) {
+	switch driver := p.GetString("db.driver", "mysql"); driver {
+	case "mysql":
+		return openMySQLStore(p)
+	case "sqlite":
+		return openSQLiteStore(p.GetString("db.path", "shorter.db"))
+	default:
+		return nil, fmt.Errorf("unsupported db.driver %q", driver)
+	}
+}
+
+// dialect 描述各数据库之间的差异，建表和迁移由各自的 open 函数负责
+type dialect interface {
+	// duplicateKey 判断 err 是否违反唯一约束，并返回冲突的键名
+	duplicateKey(err error) (string, bool)
+	txOptions() *sql.TxOptions
+}
+
+// dbExecutor 由 *sql.DB 和 *sql.Tx 共同实现
+type dbExecutor interface {
+	Exec(query string, args ...any) (sql.Result, error)
+	Query(query string, args ...any) (*sql.Rows, error)
+	QueryRow(query string, args ...any) *sql.Row
+}
+
+// sqlStore 是基于 database/sql 的通用实现，MySQL 和 SQLite 共用
+type sqlStore struct {
+	db      *sql.DB
+	ex      dbExecutor // 事务中为 *sql.Tx，否则与 db 相同
+	dialect dialect
+}
+
+const shortURLColumns = "id, short_code, long_url, click_count, expires_at, redirect_type, created_at"
+
+type rowScanner interface {
+	Scan(dest ...any) error
+}
+
+func scanShortURL(row rowScanner) (ShortURL, error) {
+	var shortURL ShortURL
+	err := row.Scan(&shortURL.ID, &shortURL.ShortCode, &shortURL.LongURL, &shortURL.ClickCount, &shortURL.ExpiresAt, &shortURL.RedirectType, &shortURL.CreatedAt)
+	if err == sql.ErrNoRows {
+		return shortURL, errNotFound
+	}
+	return shortURL, err
+}
+
+func (s *sqlStore) Create(shortURL *ShortURL, dedup bool) error {
+	var key sql.NullString
+	if dedup {
+		key = sql.NullString{String: dedupKey(shortURL.LongURL), Valid: true}
+	}
+
+	// 统一使用 UTC 并截断到秒，与 DATETIME 的精度保持一致
+	shortURL.CreatedAt = time.Now().UTC().Truncate(time.Second)
+	if shortURL.ExpiresAt.Valid {
+		shortURL.ExpiresAt.Time = shortURL.ExpiresAt.Time.UTC().Truncate(time.Second)
+	}
+
+	result, err := s.ex.Exec("INSERT INTO short_urls (short_code, long_url, expires_at, dedup_key, redirect_type, created_at) VALUES (?, ?, ?, ?, ?, ?)",
+		shortURL.ShortCode, shortURL.LongURL, shortURL.ExpiresAt, key, shortURL.RedirectType, shortURL.CreatedAt)
+	if err != nil {
+		if name, ok := s.dialect.duplicateKey(err); ok {
+			if strings.Contains(name, "dedup_key") {
+				return errURLExists
+			}
+			return errCodeTaken
+		}
+		return err
+	}
+
+	shortURL.ID, err = result.LastInsertId()
+	return err
+}
+
+func (s *sqlStore) GetByCode(shortCode string) (ShortURL, error) {
+	return scanShortURL(s.ex.QueryRow("SELECT "+shortURLColumns+" FROM short_urls WHERE short_code = ?", shortCode))
+}
+
+func (s *sqlStore) GetByLongURL(longURL string) (ShortURL, error) {
+	return scanShortURL(s.ex.QueryRow("SELECT "+shortURLColumns+" FROM short_urls WHERE dedup_key = ?", dedupKey(longURL)))
+}
+
+func (s *sqlStore) Delete(shortCode string) error {
+	result, err := s.ex.Exec("DELETE FROM short_urls WHERE short_code = ?", shortCode)
+	if err != nil {
+		return err
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return errNotFound
+	}
+	return nil
+}
+
+func (s *sqlStore) List(limit, offset int) ([]ShortURL, int64, error) {
+	var total int64
+	if err := s.ex.QueryRow("SELECT COUNT(*) FROM short_urls").Scan(&total); err != nil {
+		return nil, 0, err
+	}
+
+	rows, err := s.ex.Query("SELECT "+shortURLColumns+" FROM short_urls ORDER BY created_at DESC, id DESC LIMIT ? OFFSET ?", limit, offset)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	var shortURLs []ShortURL
+	for rows.Next() {
+		shortURL, err := scanShortURL(rows)
+		if err != nil {
+			return nil, 0, err
+		}
+		shortURLs = append(shortURLs, shortURL)
+	}
+	return shortURLs, total, rows.Err()
+}
+
+func (s *sqlStore) AddClicks(shortCode string, count int64) error {
+	_, err := s.ex.Exec("UPDATE short_urls SET click_count = click_count + ? WHERE short_code = ?", count, shortCode)
+	return err
+}
+
+func (s *sqlStore) DeleteExpired(now time.Time) (int64, error) {
+	result, err := s.ex.Exec("DELETE FROM short_urls WHERE expires_at IS NOT NULL AND expires_at < ?", now.UTC())
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+func (s *sqlStore) WithTx(fn func(tx Store) error) error {
+	tx, err := s.db.BeginTx(context.Background(), s.dialect.txOptions())
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := fn(&sqlStore{db: s.db, ex: tx, dialect: s.dialect}); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (s *sqlStore) Ping(ctx context.Context) error {
+	return s.db.PingContext(ctx)
+}
+
+func (s *sqlStore) Close() error {
+	return s.db.Close()
+}
+
+func dedupKey(longURL string) string {
+	sum := sha256.Sum256([]byte(longURL))
+	return hex.EncodeToString(sum[:])
+}
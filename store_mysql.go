@@ -0,0 +1,138 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/go-sql-driver/mysql"
+)
+
+type mysqlDialect struct{}
+
+// MySQL 错误码 1062 表示违反唯一约束，错误信息形如
+// "Duplicate entry 'x' for key 'short_urls.dedup_key'"
+func (mysqlDialect) duplicateKey(err error) (string, bool) {
+	var mysqlErr *mysql.MySQLError
+	if !errors.As(err, &mysqlErr) || mysqlErr.Number != 1062 {
+		return "", false
+	}
+
+	// 冲突的值本身可能包含任意字符，只取 "for key" 之后的部分
+	message := mysqlErr.Message
+	if i := strings.LastIndex(message, "for key "); i >= 0 {
+		return message[i:], true
+	}
+	return "", true
+}
+
+// 批量事务使用 READ COMMITTED，以便看到其他请求刚提交的记录
+func (mysqlDialect) txOptions() *sql.TxOptions {
+	return &sql.TxOptions{Isolation: sql.LevelReadCommitted}
+}
+
+func openMySQLStore(p *config) (Store, error) {
+	dbUser := p.GetString("db.user", "root")
+	dbPass := p.GetString("db.password", "")
+	dbHost := p.GetString("db.host", "localhost")
+	dbPort := p.GetInt("db.port", 3306)
+	dbName := p.GetString("db.name", "shorter")
+
+	dbSource := fmt.Sprintf("%s:%s@tcp(%s:%d)/%s?parseTime=true", dbUser, dbPass, dbHost, dbPort, dbName)
+
+	db, err := sql.Open("mysql", dbSource)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := db.Ping(); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("database connection failed: %w", err)
+	}
+
+	if err := initMySQL(db); err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	return &sqlStore{db: db, ex: db, dialect: mysqlDialect{}}, nil
+}
+
+func initMySQL(db *sql.DB) error {
+	createTableSQL := `
+		CREATE TABLE IF NOT EXISTS short_urls (
+        id INT AUTO_INCREMENT PRIMARY KEY,
+        short_code VARCHAR(255) CHARACTER SET utf8mb4 COLLATE utf8mb4_bin UNIQUE NOT NULL,
+        long_url TEXT NOT NULL,
+        click_count INT NOT NULL DEFAULT 0,
+        expires_at DATETIME NULL,
+        dedup_key CHAR(64) NULL UNIQUE,
+        redirect_type SMALLINT NOT NULL DEFAULT 302,
+        created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP
+    );
+    `
+
+	if _, err := db.Exec(createTableSQL); err != nil {
+		return err
+	}
+
+	// 为旧版本创建的表补充新增的列
+	if _, err := addColumnIfMissing(db, "short_urls", "click_count", "INT NOT NULL DEFAULT 0"); err != nil {
+		return err
+	}
+	if _, err := addColumnIfMissing(db, "short_urls", "expires_at", "DATETIME NULL"); err != nil {
+		return err
+	}
+	if _, err := addColumnIfMissing(db, "short_urls", "redirect_type", "SMALLINT NOT NULL DEFAULT 302"); err != nil {
+		return err
+	}
+	if _, err := addColumnIfMissing(db, "short_urls", "created_at", "DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP"); err != nil {
+		return err
+	}
+	// 短码区分大小写，旧表的默认排序规则会让 "abc" 与 "ABC" 冲突
+	if err := setColumnCollation(db, "short_urls", "short_code", "VARCHAR(255) CHARACTER SET utf8mb4 COLLATE utf8mb4_bin NOT NULL", "utf8mb4_bin"); err != nil {
+		return err
+	}
+	added, err := addColumnIfMissing(db, "short_urls", "dedup_key", "CHAR(64) NULL UNIQUE")
+	if err != nil || !added {
+		return err
+	}
+
+	// 每个长链接只为最早的一条永久记录回填去重键，避免违反唯一约束
+	_, err = db.Exec(`
+		UPDATE short_urls s
+		JOIN (SELECT MIN(id) AS id FROM short_urls WHERE expires_at IS NULL GROUP BY long_url) f ON s.id = f.id
+		SET s.dedup_key = SHA2(s.long_url, 256)`)
+	return err
+}
+
+// addColumnIfMissing 在列不存在时添加该列，返回是否实际执行了添加
+func addColumnIfMissing(db *sql.DB, table, column, definition string) (bool, error) {
+	var count int
+	err := db.QueryRow("SELECT COUNT(*) FROM information_schema.COLUMNS WHERE TABLE_SCHEMA = DATABASE() AND TABLE_NAME = ? AND COLUMN_NAME = ?", table, column).Scan(&count)
+	if err != nil {
+		return false, err
+	}
+	if count > 0 {
+		return false, nil
+	}
+
+	_, err = db.Exec(fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s %s", table, column, definition))
+	return err == nil, err
+}
+
+// setColumnCollation 在列的排序规则不是 collation 时按 definition 重新定义该列
+func setColumnCollation(db *sql.DB, table, column, definition, collation string) error {
+	var current sql.NullString
+	err := db.QueryRow("SELECT COLLATION_NAME FROM information_schema.COLUMNS WHERE TABLE_SCHEMA = DATABASE() AND TABLE_NAME = ? AND COLUMN_NAME = ?", table, column).Scan(&current)
+	if err != nil {
+		return err
+	}
+	if current.String == collation {
+		return nil
+	}
+
+	_, err = db.Exec(fmt.Sprintf("ALTER TABLE %s MODIFY %s %s", table, column, definition))
+	return err
+}
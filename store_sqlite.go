@@ -0,0 +1,61 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+
+	"modernc.org/sqlite"
+	sqlite3 "modernc.org/sqlite/lib"
+)
+
+type sqliteDialect struct{}
+
+// SQLite 的错误信息形如 "UNIQUE constraint failed: short_urls.dedup_key"
+func (sqliteDialect) duplicateKey(err error) (string, bool) {
+	var sqliteErr *sqlite.Error
+	if !errors.As(err, &sqliteErr) || sqliteErr.Code() != sqlite3.SQLITE_CONSTRAINT_UNIQUE {
+		return "", false
+	}
+	return sqliteErr.Error(), true
+}
+
+// SQLite 只支持默认的串行化隔离级别
+func (sqliteDialect) txOptions() *sql.TxOptions {
+	return nil
+}
+
+// openSQLiteStore 打开或创建 SQLite 数据库文件，path 为 ":memory:" 时使用内存数据库
+func openSQLiteStore(path string) (Store, error) {
+	db, err := sql.Open("sqlite", path)
+	if err != nil {
+		return nil, err
+	}
+
+	// SQLite 同一时间只允许一个写入者，内存数据库也只存在于单个连接中
+	db.SetMaxOpenConns(1)
+
+	if err := initSQLite(db); err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	return &sqlStore{db: db, ex: db, dialect: sqliteDialect{}}, nil
+}
+
+func initSQLite(db *sql.DB) error {
+	createTableSQL := `
+		CREATE TABLE IF NOT EXISTS short_urls (
+        id INTEGER PRIMARY KEY AUTOINCREMENT,
+        short_code TEXT UNIQUE NOT NULL,
+        long_url TEXT NOT NULL,
+        click_count INTEGER NOT NULL DEFAULT 0,
+        expires_at DATETIME NULL,
+        dedup_key TEXT NULL UNIQUE,
+        redirect_type INTEGER NOT NULL DEFAULT 302,
+        created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP
+    );
+    `
+
+	_, err := db.Exec(createTableSQL)
+	return err
+}
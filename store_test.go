@@ -0,0 +1,112 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func newTestStore(t *testing.T) Store {
+	t.Helper()
+	s, err := openSQLiteStore(":memory:")
+	if err != nil {
+		t.Fatalf("openSQLiteStore: %v", err)
+	}
+	t.Cleanup(func() { s.Close() })
+	return s
+}
+
+func TestStoreRoundTrip(t *testing.T) {
+	s := newTestStore(t)
+
+	expiresAt := sql.NullTime{Time: time.Now().Add(time.Hour), Valid: true}
+	created := ShortURL{ShortCode: "abc", LongURL: "https://example.com/a", ExpiresAt: expiresAt, RedirectType: http.StatusMovedPermanently}
+	if err := s.Create(&created, false); err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	if created.ID == 0 || created.CreatedAt.IsZero() {
+		t.Fatalf("Create did not fill ID and CreatedAt: %+v", created)
+	}
+
+	got, err := s.GetByCode("abc")
+	if err != nil {
+		t.Fatalf("GetByCode: %v", err)
+	}
+	if got.ID != created.ID || got.LongURL != created.LongURL || got.RedirectType != created.RedirectType ||
+		!got.ExpiresAt.Valid || !got.ExpiresAt.Time.Equal(created.ExpiresAt.Time) || !got.CreatedAt.Equal(created.CreatedAt) {
+		t.Errorf("GetByCode = %+v, want %+v", got, created)
+	}
+
+	// 未参与去重的记录不能通过长链接查到
+	if _, err := s.GetByLongURL("https://example.com/a"); !errors.Is(err, errNotFound) {
+		t.Errorf("GetByLongURL on non-dedup record: err = %v, want errNotFound", err)
+	}
+
+	dedup := ShortURL{ShortCode: "def", LongURL: "https://example.com/b", RedirectType: http.StatusFound}
+	if err := s.Create(&dedup, true); err != nil {
+		t.Fatalf("Create dedup: %v", err)
+	}
+	got, err = s.GetByLongURL("https://example.com/b")
+	if err != nil {
+		t.Fatalf("GetByLongURL: %v", err)
+	}
+	if got.ShortCode != "def" {
+		t.Errorf("GetByLongURL code = %q, want %q", got.ShortCode, "def")
+	}
+
+	list, total, err := s.List(10, 0)
+	if err != nil {
+		t.Fatalf("List: %v", err)
+	}
+	if total != 2 || len(list) != 2 {
+		t.Fatalf("List = %d records, total %d, want 2, 2", len(list), total)
+	}
+	if list[0].ShortCode != "def" || list[1].ShortCode != "abc" {
+		t.Errorf("List order = %q, %q, want newest first", list[0].ShortCode, list[1].ShortCode)
+	}
+	if list, total, err = s.List(1, 1); err != nil || total != 2 || len(list) != 1 || list[0].ShortCode != "abc" {
+		t.Errorf("List(1, 1) = %v, %d, %v; want [abc], 2", list, total, err)
+	}
+
+	if err := s.Delete("abc"); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+	if _, err := s.GetByCode("abc"); !errors.Is(err, errNotFound) {
+		t.Errorf("GetByCode after Delete: err = %v, want errNotFound", err)
+	}
+	if err := s.Delete("abc"); !errors.Is(err, errNotFound) {
+		t.Errorf("second Delete: err = %v, want errNotFound", err)
+	}
+}
+
+func TestStoreCreateConflicts(t *testing.T) {
+	s := newTestStore(t)
+
+	if err := s.Create(&ShortURL{ShortCode: "abc", LongURL: "https://example.com/a", RedirectType: http.StatusFound}, true); err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+
+	tests := []struct {
+		name  string
+		url   ShortURL
+		dedup bool
+		want  error
+	}{
+		{"same code", ShortURL{ShortCode: "abc", LongURL: "https://example.com/other"}, false, errCodeTaken},
+		{"same code and url", ShortURL{ShortCode: "abc", LongURL: "https://example.com/a"}, false, errCodeTaken},
+		{"same dedup url", ShortURL{ShortCode: "xyz", LongURL: "https://example.com/a"}, true, errURLExists},
+		{"same url without dedup", ShortURL{ShortCode: "xyz", LongURL: "https://example.com/a"}, false, nil},
+		// 短码区分大小写
+		{"different case", ShortURL{ShortCode: "ABC", LongURL: "https://example.com/c"}, false, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.url.RedirectType = http.StatusFound
+			if err := s.Create(&tt.url, tt.dedup); !errors.Is(err, tt.want) {
+				t.Errorf("Create = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}